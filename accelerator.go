@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"golang.org/x/exp/slog"
+)
+
+// prepareTokenTTL bounds how long a client has between preparing an accelerated upload and
+// finalizing it.
+const prepareTokenTTL = 15 * time.Minute
+
+// ShardPlan describes one CAR shard the client has already built locally.
+type ShardPlan struct {
+	CID  string `json:"cid"`
+	Size uint64 `json:"size"`
+}
+
+// PrepareRequest is the body of POST /api/v1/upload/prepare.
+type PrepareRequest struct {
+	Root   string      `json:"root"`
+	Shards []ShardPlan `json:"shards"`
+}
+
+// ShardUploadPlan tells the client where (and whether) it needs to PUT a shard it already has.
+type ShardUploadPlan struct {
+	CID     string            `json:"cid"`
+	Status  string            `json:"status"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// PrepareResponse is the body returned by POST /api/v1/upload/prepare.
+type PrepareResponse struct {
+	Token  string            `json:"token"`
+	Shards []ShardUploadPlan `json:"shards"`
+}
+
+// FinalizeRequest is the body of POST /api/v1/upload/finalize.
+type FinalizeRequest struct {
+	Token  string   `json:"token"`
+	Shards []string `json:"shards"`
+}
+
+// prepareTokenPayload is the part of a finalization token that gets signed; it is opaque to the
+// client and round-tripped verbatim.
+type prepareTokenPayload struct {
+	Root      string `json:"root"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Prepare handles POST /api/v1/upload/prepare: the client has already built its CAR shards
+// locally and just needs presigned PUT URLs plus a token to finalize with, so the service never
+// has to see the bytes.
+func (h *Handlers) Prepare(rw http.ResponseWriter, r *http.Request) {
+	var req PrepareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	root, err := cid.Decode(req.Root)
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("invalid root: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	plans := make([]ShardUploadPlan, len(req.Shards))
+	for i, shard := range req.Shards {
+		shardCid, err := cid.Decode(shard.CID)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("invalid shard cid %q: %s", shard.CID, err), http.StatusBadRequest)
+			return
+		}
+
+		presign, err := h.uploader.Presign(cidlink.Link{Cid: shardCid}, shard.Size)
+		if err != nil {
+			slog.Error("presign shard", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		plans[i] = ShardUploadPlan{
+			CID:     shard.CID,
+			Status:  presign.Status,
+			URL:     presign.URL,
+			Headers: presign.Headers,
+		}
+	}
+
+	token, err := h.signPrepareToken(root)
+	if err != nil {
+		slog.Error("sign prepare token", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rw, &PrepareResponse{Token: token, Shards: plans})
+}
+
+// Finalize handles POST /api/v1/upload/finalize: once the client has PUT every shard itself, it
+// trades its token and the shard list for the upload/add invocation.
+func (h *Handlers) Finalize(rw http.ResponseWriter, r *http.Request) {
+	var req FinalizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Shards) == 0 {
+		http.Error(rw, "shards must not be empty", http.StatusBadRequest)
+		return
+	}
+
+	root, err := h.verifyPrepareToken(req.Token)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	shards := make([]ipld.Link, len(req.Shards))
+	for i, s := range req.Shards {
+		shardCid, err := cid.Decode(s)
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("invalid shard cid %q: %s", s, err), http.StatusBadRequest)
+			return
+		}
+		shards[i] = cidlink.Link{Cid: shardCid}
+	}
+
+	result, err := h.uploader.Finalize(root, shards)
+	if err != nil {
+		slog.Error("finalize upload", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(rw, &UploadResponse{Root: result.Root.String(), Shards: cidsToStrings(result.Shards)})
+}
+
+// signPrepareToken produces a tamper-evident token binding root to this prepare/finalize round
+// trip, so Finalize doesn't have to trust the client's say-so about which upload it's completing.
+func (h *Handlers) signPrepareToken(root cid.Cid) (string, error) {
+	payload, err := json.Marshal(prepareTokenPayload{
+		Root:      root.String(),
+		ExpiresAt: time.Now().Add(prepareTokenTTL).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("marshaling token payload: %s", err)
+	}
+
+	mac := hmac.New(sha256.New, h.tokenSecret)
+	_, _ = mac.Write(payload)
+
+	return fmt.Sprintf(
+		"%s.%s",
+		base64.RawURLEncoding.EncodeToString(payload),
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil)),
+	), nil
+}
+
+func (h *Handlers) verifyPrepareToken(token string) (cid.Cid, error) {
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return cid.Undef, fmt.Errorf("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(payloadPart)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("malformed token")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(sigPart)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("malformed token")
+	}
+
+	mac := hmac.New(sha256.New, h.tokenSecret)
+	_, _ = mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return cid.Undef, fmt.Errorf("invalid token signature")
+	}
+
+	var parsed prepareTokenPayload
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return cid.Undef, fmt.Errorf("malformed token payload")
+	}
+	if time.Now().Unix() > parsed.ExpiresAt {
+		return cid.Undef, fmt.Errorf("token expired")
+	}
+
+	root, err := cid.Decode(parsed.Root)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("malformed token root: %s", err)
+	}
+	return root, nil
+}
+
+func writeJSON(rw http.ResponseWriter, v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("json marshaling", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(b)
+}
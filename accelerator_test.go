@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareTokenRoundTrip(t *testing.T) {
+	h := &Handlers{tokenSecret: []byte("test-secret")}
+
+	root := cid.MustParse("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+
+	token, err := h.signPrepareToken(root)
+	require.NoError(t, err)
+
+	got, err := h.verifyPrepareToken(token)
+	require.NoError(t, err)
+	require.Equal(t, root, got)
+}
+
+func TestPrepareTokenTamperedSignature(t *testing.T) {
+	h := &Handlers{tokenSecret: []byte("test-secret")}
+
+	root := cid.MustParse("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	token, err := h.signPrepareToken(root)
+	require.NoError(t, err)
+
+	_, err = h.verifyPrepareToken(token + "tampered")
+	require.Error(t, err)
+}
+
+func TestPrepareTokenWrongSecret(t *testing.T) {
+	signer := &Handlers{tokenSecret: []byte("secret-a")}
+	verifier := &Handlers{tokenSecret: []byte("secret-b")}
+
+	root := cid.MustParse("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	token, err := signer.signPrepareToken(root)
+	require.NoError(t, err)
+
+	_, err = verifier.verifyPrepareToken(token)
+	require.Error(t, err)
+}
+
+func TestPrepareTokenExpired(t *testing.T) {
+	h := &Handlers{tokenSecret: []byte("test-secret")}
+
+	payload, err := json.Marshal(prepareTokenPayload{
+		Root:      cid.MustParse("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku").String(),
+		ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+
+	mac := hmac.New(sha256.New, h.tokenSecret)
+	_, _ = mac.Write(payload)
+	token := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	_, err = h.verifyPrepareToken(token)
+	require.Error(t, err)
+}
+
+func TestPrepareTokenMalformed(t *testing.T) {
+	h := &Handlers{tokenSecret: []byte("test-secret")}
+
+	_, err := h.verifyPrepareToken("not-a-token")
+	require.Error(t, err)
+
+	_, err = h.verifyPrepareToken("not*base64!.also*not*base64!")
+	require.Error(t, err)
+}
@@ -6,12 +6,30 @@ import (
 )
 
 type config struct {
-	PrivateKey string `default:""`
-	Proof      string `default:""`
-	HTTP       struct {
+	PrivateKey string   `default:""`
+	Proof      string   `default:""`
+	HashAlgos  []string `default:""`
+	// TokenSecret is the HMAC key used to sign accelerator prepare/finalize tokens. It must be
+	// configured explicitly and kept stable across restarts and replicas: a token signed by one
+	// instance has to verify on any other.
+	TokenSecret string `default:""`
+	HTTP        struct {
 		Port string `default:"8080"`
 	}
 
+	Upload struct {
+		// Concurrency bounds how many CAR shards are in flight to w3s at once.
+		Concurrency int `default:"4"`
+		// MaxAttempts bounds how many times a single shard PUT is tried, the first try included,
+		// before the upload fails.
+		MaxAttempts int `default:"5"`
+	}
+
+	Gateway struct {
+		// URL is the IPFS gateway content is fetched from for GET /api/v1/content/{cid}.
+		URL string `default:"https://w3s.link"`
+	}
+
 	Log struct {
 		Human bool `default:"false"`
 		Debug bool `default:"false"`
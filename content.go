@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/file"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/exp/slog"
+)
+
+// gatewayFetcher retrieves raw blocks by CID from an IPFS gateway, the read-side counterpart of
+// the shards this service writes via storeShard, verifying each block's hash before handing it
+// back to the UnixFS reassembler.
+type gatewayFetcher struct {
+	baseURL string
+}
+
+func newGatewayFetcher(baseURL string) *gatewayFetcher {
+	return &gatewayFetcher{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// linkSystem returns an ipld.LinkSystem that resolves blocks by fetching them from the gateway.
+// Only StorageReadOpener is set, since retrieval never produces new blocks.
+func (f *gatewayFetcher) linkSystem() ipld.LinkSystem {
+	ls := cidlink.DefaultLinkSystem()
+	ls.TrustedStorage = false
+	ls.StorageReadOpener = func(lctx ipld.LinkContext, l ipld.Link) (io.Reader, error) {
+		cl, ok := l.(cidlink.Link)
+		if !ok {
+			return nil, fmt.Errorf("not a cidlink")
+		}
+
+		data, err := f.fetch(lctx.Ctx, cl.Cid)
+		if err != nil {
+			return nil, err
+		}
+
+		return bytes.NewReader(data), nil
+	}
+	return ls
+}
+
+// fetch retrieves the raw bytes of block c from the gateway and verifies them against c's
+// multihash, so a misbehaving gateway can't smuggle in unrelated data.
+func (f *gatewayFetcher) fetch(ctx context.Context, c cid.Cid) ([]byte, error) {
+	url := fmt.Sprintf("%s/ipfs/%s?format=raw", f.baseURL, c.String())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %s", err)
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("doing HTTP request: %s", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gateway returned status %d for %s", res.StatusCode, c)
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading block body: %s", err)
+	}
+
+	prefix := c.Prefix()
+	mh, err := multihash.Sum(data, prefix.MhType, prefix.MhLength)
+	if err != nil {
+		return nil, fmt.Errorf("hashing block %s: %s", c, err)
+	}
+	if !bytes.Equal(mh, c.Hash()) {
+		return nil, fmt.Errorf("block %s failed hash verification", c)
+	}
+
+	return data, nil
+}
+
+// Content handles GET and HEAD /api/v1/content/{cid}: it fetches the UnixFS DAG rooted at cid
+// from the configured gateway and streams the reassembled file back, delegating Content-Type
+// sniffing, Content-Length, and Range handling to http.ServeContent.
+func (h *Handlers) Content(rw http.ResponseWriter, r *http.Request) {
+	c, err := cid.Decode(mux.Vars(r)["cid"])
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("invalid cid: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	ls := h.gateway.linkSystem()
+
+	nd, err := ls.Load(ipld.LinkContext{Ctx: r.Context()}, cidlink.Link{Cid: c}, basicnode.Prototype.Any)
+	if err != nil {
+		slog.Error("loading content root", err)
+		http.Error(rw, "content not found", http.StatusNotFound)
+		return
+	}
+
+	ufsFile, err := file.NewUnixFSFile(r.Context(), nd, &ls)
+	if err != nil {
+		slog.Error("reassembling UnixFS file", err)
+		http.Error(rw, "content not found", http.StatusNotFound)
+		return
+	}
+
+	content, err := ufsFile.AsLargeBytes()
+	if err != nil {
+		slog.Error("reading UnixFS file", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("ETag", fmt.Sprintf("%q", c.String()))
+	rw.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+
+	http.ServeContent(rw, r, c.String(), time.Time{}, content)
+}
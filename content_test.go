@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func rawCid(t *testing.T, data []byte) cid.Cid {
+	t.Helper()
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+func TestGatewayFetcherFetch(t *testing.T) {
+	data := []byte("block content")
+	c := rawCid(t, data)
+
+	gw := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		_, _ = rw.Write(data)
+	}))
+	defer gw.Close()
+
+	f := newGatewayFetcher(gw.URL)
+	got, err := f.fetch(context.Background(), c)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestGatewayFetcherFetchHashMismatch(t *testing.T) {
+	data := []byte("block content")
+	c := rawCid(t, data)
+
+	gw := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Return different bytes than the CID commits to, simulating a misbehaving gateway.
+		_, _ = rw.Write([]byte("not the block you're looking for"))
+	}))
+	defer gw.Close()
+
+	f := newGatewayFetcher(gw.URL)
+	_, err := f.fetch(context.Background(), c)
+	require.Error(t, err)
+}
+
+func TestGatewayFetcherFetchNonOK(t *testing.T) {
+	gw := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusNotFound)
+	}))
+	defer gw.Close()
+
+	f := newGatewayFetcher(gw.URL)
+	_, err := f.fetch(context.Background(), rawCid(t, []byte("whatever")))
+	require.Error(t, err)
+}
@@ -4,22 +4,31 @@ import (
 	"bufio"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
+	"github.com/ipfs/go-cid"
 	"golang.org/x/exp/slog"
 )
 
 // Handlers groups a bunch of HTTP handlers.
 type Handlers struct {
-	uploader *Uploader
-	tmpDir   string
+	uploader    *Uploader
+	tmpDir      string
+	tusStore    tusStore
+	hashAlgos   []string
+	tokenSecret []byte
+	gateway     *gatewayFetcher
 }
 
 // UploadResponse ...
 type UploadResponse struct {
-	Root  string `json:"root"`
-	Shard string `json:"shard"`
+	Root   string            `json:"root"`
+	Shards []string          `json:"shards"`
+	Hashes map[string]string `json:"hashes,omitempty"`
 }
 
 // Health is a health checker.
@@ -35,20 +44,47 @@ func (h *Handlers) Upload(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// parse file field
-	p, err := reader.NextPart()
-	if err != nil && err != io.EOF {
-		http.Error(rw, err.Error(), http.StatusInternalServerError)
-		return
+	// Walk parts until the file field, stashing any form fields (e.g. "hashes") found along
+	// the way so they can be read the same as a query parameter.
+	form := map[string]string{}
+	var p *multipart.Part
+	for {
+		p, err = reader.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if p.FormName() == "file" {
+			break
+		}
+
+		v, err := io.ReadAll(p)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		form[p.FormName()] = string(v)
+		p = nil
 	}
 
-	if p.FormName() != "file" {
+	if p == nil {
 		http.Error(rw, "file is expected", http.StatusBadRequest)
 		return
 	}
 
+	algos := h.hashAlgos
+	if v := r.URL.Query().Get("hashes"); v != "" {
+		algos = strings.Split(v, ",")
+	} else if v := form["hashes"]; v != "" {
+		algos = strings.Split(v, ",")
+	}
+
 	buf := bufio.NewReader(p)
-	result, err := h.uploader.Upload(r.Context(), buf)
+	result, err := h.uploader.Upload(r.Context(), buf, algos)
 	if err != nil {
 		slog.Error("file upload", err)
 		rw.WriteHeader(http.StatusInternalServerError)
@@ -56,8 +92,9 @@ func (h *Handlers) Upload(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	response := &UploadResponse{
-		Root:  result.Root.String(),
-		Shard: result.Shard.String(),
+		Root:   result.Root.String(),
+		Shards: cidsToStrings(result.Shards),
+		Hashes: result.Hashes,
 	}
 
 	bytes, err := json.Marshal(response)
@@ -69,19 +106,43 @@ func (h *Handlers) Upload(rw http.ResponseWriter, r *http.Request) {
 	_, _ = rw.Write(bytes)
 }
 
+// cidsToStrings renders each CID in cids with String(), for embedding in a JSON response.
+func cidsToStrings(cids []cid.Cid) []string {
+	out := make([]string, len(cids))
+	for i, c := range cids {
+		out[i] = c.String()
+	}
+	return out
+}
+
 func initHandlers(cfg *config) (*Handlers, error) {
 	proof, err := hex.DecodeString(cfg.Proof)
 	if err != nil {
 		return nil, err
 	}
 
-	uploader, err := NewUploader(cfg.SpaceID, cfg.PrivateKey, proof, cfg.TmpDir)
+	uploader, err := NewUploader(cfg.SpaceID, cfg.PrivateKey, proof, UploadConfig{
+		Concurrency: cfg.Upload.Concurrency,
+		MaxAttempts: cfg.Upload.MaxAttempts,
+	})
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.TokenSecret == "" {
+		return nil, fmt.Errorf("TokenSecret is required")
+	}
+	tokenSecret, err := hex.DecodeString(cfg.TokenSecret)
+	if err != nil {
+		return nil, fmt.Errorf("decoding token secret: %s", err)
+	}
+
 	return &Handlers{
-		uploader: uploader,
-		tmpDir:   cfg.TmpDir,
+		uploader:    uploader,
+		tmpDir:      cfg.TmpDir,
+		tusStore:    newFsTusStore(cfg.TmpDir),
+		hashAlgos:   cfg.HashAlgos,
+		tokenSecret: tokenSecret,
+		gateway:     newGatewayFetcher(cfg.Gateway.URL),
 	}, nil
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/md5"  // nolint:gosec
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"lukechampine.com/blake3"
+)
+
+// namedHash pairs a requested algorithm name with the hash.Hash accumulating its digest.
+type namedHash struct {
+	name string
+	hash hash.Hash
+}
+
+// hashSet is the set of hashers a single upload fans its bytes out to.
+type hashSet []namedHash
+
+// newHashSet builds a hasher for each requested algorithm, so the caller can fan a single read
+// out to all of them with an io.MultiWriter.
+func newHashSet(algos []string) (hashSet, error) {
+	set := make(hashSet, 0, len(algos))
+	for _, algo := range algos {
+		h, err := newHasher(algo)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, namedHash{name: strings.ToLower(algo), hash: h})
+	}
+	return set, nil
+}
+
+func newHasher(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case "sha1":
+		return sha1.New(), nil // nolint:gosec
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil // nolint:gosec
+	case "blake3":
+		return blake3.New(32, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algo)
+	}
+}
+
+// sums returns the hex-encoded digest of every hasher in the set, keyed by algorithm name. It
+// returns nil (not an empty map) when the set is empty, so callers can omit it from a response.
+func (set hashSet) sums() map[string]string {
+	if len(set) == 0 {
+		return nil
+	}
+	sums := make(map[string]string, len(set))
+	for _, h := range set {
+		sums[h.name] = hex.EncodeToString(h.hash.Sum(nil))
+	}
+	return sums
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHashSet(t *testing.T) {
+	set, err := newHashSet([]string{"sha256", "SHA1", "md5", "blake3"})
+	require.NoError(t, err)
+	require.Len(t, set, 4)
+
+	_, err = writeAll(set, "Hello")
+	require.NoError(t, err)
+
+	sums := set.sums()
+	require.Equal(t, "185f8db32271fe25f561a6fc938b2e264306ec304eda518007d1764826381969", sums["sha256"])
+	require.Equal(t, "f7ff9e8b7bb2e09b70935a5d785e0cc5d9d0abf0", sums["sha1"])
+	require.Equal(t, "8b1a9953c4611296a827abf8c47804d7", sums["md5"])
+	require.Len(t, sums["blake3"], 64) // 32-byte digest, hex-encoded
+}
+
+func writeAll(set hashSet, s string) (int, error) {
+	var n int
+	for _, h := range set {
+		written, err := h.hash.Write([]byte(s))
+		if err != nil {
+			return n, err
+		}
+		n += written
+	}
+	return n, nil
+}
+
+func TestNewHashSetUnsupportedAlgo(t *testing.T) {
+	_, err := newHashSet([]string{"sha512"})
+	require.Error(t, err)
+}
+
+func TestHashSetSumsEmpty(t *testing.T) {
+	set, err := newHashSet(nil)
+	require.NoError(t, err)
+	require.Nil(t, set.sums())
+}
@@ -9,6 +9,7 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/exp/slog"
 )
 
@@ -27,7 +28,24 @@ func main() {
 
 	router := newRouter()
 	router.post("/api/v1/upload", handlers.Upload)
+	router.post("/api/v1/upload/prepare", handlers.Prepare)
+	router.post("/api/v1/upload/finalize", handlers.Finalize)
 	router.get("/api/v1/health", handlers.Health)
+	router.get("/metrics", promhttp.Handler().ServeHTTP)
+
+	// Streaming a large UnixFS file back can also run past the default write timeout.
+	router.get("/api/v1/content/{cid}", handlers.Content, noDeadline)
+	router.head("/api/v1/content/{cid}", handlers.Content, noDeadline)
+
+	// tus creation and PATCH can run well past the server's default read/write timeouts on
+	// large or slow uploads, so they opt out of the deadline that applies to the rest of the API.
+	router.post("/api/v1/uploads", handlers.TusCreate, noDeadline)
+	router.head("/api/v1/uploads/{id}", handlers.TusHead)
+	router.patch("/api/v1/uploads/{id}", handlers.TusPatch, noDeadline)
+	router.delete("/api/v1/uploads/{id}", handlers.TusTerminate)
+	router.options("/api/v1/uploads", handlers.TusOptions)
+	router.options("/api/v1/uploads/{id}", handlers.TusOptions)
+	router.catchOptions()
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf("0.0.0.0:%s", cfg.HTTP.Port),
@@ -58,5 +58,5 @@ func TestUploadApi(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Equal(t, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", r.Root)
-	require.Equal(t, "bagbaierakdtubdzo53sy6crqkmmwdhomjse3vj5yijkvbopbwt66zqbangpa", r.Shard)
+	require.Equal(t, []string{"bagbaierakdtubdzo53sy6crqkmmwdhomjse3vj5yijkvbopbwt66zqbangpa"}, r.Shards)
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	uploadShardBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "basin_upload_shard_bytes",
+		Help:    "Size in bytes of each CAR shard shipped to w3s.",
+		Buckets: prometheus.ExponentialBuckets(1<<10, 4, 10),
+	})
+
+	uploadShardLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "basin_upload_shard_latency_seconds",
+		Help:    "Time to store/add and, if required, PUT a single CAR shard.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	uploadShardRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "basin_upload_shard_retries_total",
+		Help: "Number of shard PUT attempts that were retried after a network error or a 5xx/429 response.",
+	})
+
+	uploadShardFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "basin_upload_shard_failures_total",
+		Help: "Number of shards that failed to upload after exhausting their retry budget.",
+	})
+)
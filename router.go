@@ -2,10 +2,23 @@ package main
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
+// noDeadline disables the server's read/write deadlines for a route, so handlers that stream
+// large bodies for longer than the default timeouts (tus uploads, content downloads) aren't cut
+// off mid-transfer. The route remains subject to the request's own context cancellation.
+func noDeadline(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(rw)
+		_ = rc.SetReadDeadline(time.Time{})
+		_ = rc.SetWriteDeadline(time.Time{})
+		next.ServeHTTP(rw, r)
+	})
+}
+
 // Router provides a nice api around mux.Router.
 type Router struct {
 	r *mux.Router
@@ -14,7 +27,6 @@ type Router struct {
 // newRouter is a Mux HTTP router constructor.
 func newRouter() *Router {
 	r := mux.NewRouter()
-	r.PathPrefix("/").Methods(http.MethodOptions) // accept OPTIONS on all routes and do nothing
 	return &Router{r: r}
 }
 
@@ -32,7 +44,41 @@ func (r *Router) post(uri string, f http.HandlerFunc, mid ...mux.MiddlewareFunc)
 	sub.Use(mid...)
 }
 
+// head creates a subroute on the specified URI that only accepts HEAD. You can provide specific middlewares.
+func (r *Router) head(uri string, f http.HandlerFunc, mid ...mux.MiddlewareFunc) {
+	sub := r.r.Path(uri).Subrouter()
+	sub.HandleFunc("", f).Methods(http.MethodHead)
+	sub.Use(mid...)
+}
+
+// patch creates a subroute on the specified URI that only accepts PATCH. You can provide specific middlewares.
+func (r *Router) patch(uri string, f http.HandlerFunc, mid ...mux.MiddlewareFunc) {
+	sub := r.r.Path(uri).Subrouter()
+	sub.HandleFunc("", f).Methods(http.MethodPatch)
+	sub.Use(mid...)
+}
+
+// delete creates a subroute on the specified URI that only accepts DELETE. You can provide specific middlewares.
+func (r *Router) delete(uri string, f http.HandlerFunc, mid ...mux.MiddlewareFunc) { // nolint
+	sub := r.r.Path(uri).Subrouter()
+	sub.HandleFunc("", f).Methods(http.MethodDelete)
+	sub.Use(mid...)
+}
+
+// options creates a subroute on the specified URI that only accepts OPTIONS. You can provide specific middlewares.
+func (r *Router) options(uri string, f http.HandlerFunc, mid ...mux.MiddlewareFunc) {
+	sub := r.r.Path(uri).Subrouter()
+	sub.HandleFunc("", f).Methods(http.MethodOptions)
+	sub.Use(mid...)
+}
+
 // use adds middlewares to all routes. Should be used when a middleware should be execute all all routes (e.g. CORS).
 func (r *Router) use(mid ...mux.MiddlewareFunc) { // nolint
 	r.r.Use(mid...)
 }
+
+// catchOptions accepts OPTIONS on any route not already handled and does nothing. Register it
+// last so that explicit OPTIONS routes (e.g. the tus endpoints) get a chance to match first.
+func (r *Router) catchOptions() {
+	r.r.PathPrefix("/").Methods(http.MethodOptions)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" // nolint:gosec
+	"crypto/rand"
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	tusResumableVersion = "1.0.0"
+	tusExtensions       = "creation,creation-with-upload,termination,checksum"
+
+	// tusStatusChecksumMismatch is the non-standard status code the tus checksum extension
+	// expects when the uploaded chunk doesn't match the declared Upload-Checksum.
+	tusStatusChecksumMismatch = 460
+)
+
+// tusUploadMeta is the sidecar persisted alongside a partial tus upload.
+type tusUploadMeta struct {
+	ID       string            `json:"id"`
+	Length   int64             `json:"length"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// tusStore persists in-progress tus resumable uploads and their metadata, so that uploads can
+// survive across PATCH requests (and process restarts, for a durable implementation).
+type tusStore interface {
+	create(length int64, metadata map[string]string) (tusUploadMeta, error)
+	info(id string) (tusUploadMeta, error)
+	saveInfo(meta tusUploadMeta) error
+	writeAt(id string, offset int64, r io.Reader) (int64, error)
+	reader(id string) (io.ReadCloser, error)
+	remove(id string) error
+}
+
+// fsTusStore is a tusStore backed by plain files under a directory: "<id>.bin" holds the partial
+// payload and "<id>.info.json" holds the tusUploadMeta sidecar.
+type fsTusStore struct {
+	dir string
+}
+
+// newFsTusStore returns a tusStore rooted at dir.
+func newFsTusStore(dir string) *fsTusStore {
+	return &fsTusStore{dir: dir}
+}
+
+func (s *fsTusStore) binPath(id string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.bin", id))
+}
+
+func (s *fsTusStore) infoPath(id string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s.info.json", id))
+}
+
+func (s *fsTusStore) create(length int64, metadata map[string]string) (tusUploadMeta, error) {
+	randBytes := make([]byte, 16)
+	if _, err := rand.Read(randBytes); err != nil {
+		return tusUploadMeta{}, fmt.Errorf("generating upload id: %s", err)
+	}
+
+	meta := tusUploadMeta{
+		ID:       hex.EncodeToString(randBytes),
+		Length:   length,
+		Metadata: metadata,
+	}
+
+	f, err := os.Create(s.binPath(meta.ID))
+	if err != nil {
+		return tusUploadMeta{}, fmt.Errorf("creating upload file: %s", err)
+	}
+	if err := f.Close(); err != nil {
+		return tusUploadMeta{}, fmt.Errorf("closing upload file: %s", err)
+	}
+
+	if err := s.saveInfo(meta); err != nil {
+		return tusUploadMeta{}, err
+	}
+
+	return meta, nil
+}
+
+func (s *fsTusStore) saveInfo(meta tusUploadMeta) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("marshaling upload metadata: %s", err)
+	}
+	if err := os.WriteFile(s.infoPath(meta.ID), b, 0o600); err != nil {
+		return fmt.Errorf("writing upload metadata: %s", err)
+	}
+	return nil
+}
+
+func (s *fsTusStore) info(id string) (tusUploadMeta, error) {
+	b, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		return tusUploadMeta{}, fmt.Errorf("reading upload metadata: %s", err)
+	}
+	var meta tusUploadMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return tusUploadMeta{}, fmt.Errorf("unmarshaling upload metadata: %s", err)
+	}
+	return meta, nil
+}
+
+func (s *fsTusStore) writeAt(id string, offset int64, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(s.binPath(id), os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("opening upload file: %s", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seeking upload file: %s", err)
+	}
+
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return n, fmt.Errorf("writing upload file: %s", err)
+	}
+	return n, nil
+}
+
+func (s *fsTusStore) reader(id string) (io.ReadCloser, error) {
+	f, err := os.Open(s.binPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("opening completed upload: %s", err)
+	}
+	return f, nil
+}
+
+func (s *fsTusStore) remove(id string) error {
+	if err := os.Remove(s.binPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing upload file: %s", err)
+	}
+	if err := os.Remove(s.infoPath(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing upload metadata: %s", err)
+	}
+	return nil
+}
+
+// TusOptions handles OPTIONS on the tus endpoints, advertising the supported protocol version
+// and extensions.
+func (h *Handlers) TusOptions(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Tus-Resumable", tusResumableVersion)
+	rw.Header().Set("Tus-Version", tusResumableVersion)
+	rw.Header().Set("Tus-Extension", tusExtensions)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate handles POST /api/v1/uploads, the tus creation extension. If the request carries a
+// body with Content-Type application/offset+octet-stream, the creation-with-upload extension
+// applies and that body is written as the first chunk.
+func (h *Handlers) TusCreate(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Tus-Resumable", tusResumableVersion)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(rw, "Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := h.tusStore.create(length, metadata)
+	if err != nil {
+		slog.Error("tus create", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("Content-Type") == "application/offset+octet-stream" {
+		var ok bool
+		if meta, ok = h.tusWriteChunk(rw, r, meta, 0); !ok {
+			return
+		}
+		rw.Header().Set("Upload-Offset", strconv.FormatInt(meta.Offset, 10))
+	}
+
+	rw.Header().Set("Location", fmt.Sprintf("/api/v1/uploads/%s", meta.ID))
+	rw.WriteHeader(http.StatusCreated)
+}
+
+// TusHead handles HEAD /api/v1/uploads/{id}, reporting the current offset of a partial upload.
+func (h *Handlers) TusHead(rw http.ResponseWriter, r *http.Request) {
+	meta, err := h.tusStore.info(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(rw, "upload not found", http.StatusNotFound)
+		return
+	}
+
+	rw.Header().Set("Tus-Resumable", tusResumableVersion)
+	rw.Header().Set("Upload-Offset", strconv.FormatInt(meta.Offset, 10))
+	rw.Header().Set("Upload-Length", strconv.FormatInt(meta.Length, 10))
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.WriteHeader(http.StatusOK)
+}
+
+// TusPatch handles PATCH /api/v1/uploads/{id}, appending a chunk at the offset the client claims
+// to be resuming from. On the terminal chunk, it hands the completed upload to Uploader.Upload.
+func (h *Handlers) TusPatch(rw http.ResponseWriter, r *http.Request) {
+	rw.Header().Set("Tus-Resumable", tusResumableVersion)
+
+	id := mux.Vars(r)["id"]
+	meta, err := h.tusStore.info(id)
+	if err != nil {
+		http.Error(rw, "upload not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(rw, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != meta.Offset {
+		http.Error(rw, "Upload-Offset does not match current offset", http.StatusConflict)
+		return
+	}
+
+	meta, ok := h.tusWriteChunk(rw, r, meta, offset)
+	if !ok {
+		return
+	}
+
+	rw.Header().Set("Upload-Offset", strconv.FormatInt(meta.Offset, 10))
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// TusTerminate handles DELETE /api/v1/uploads/{id}, the tus termination extension.
+func (h *Handlers) TusTerminate(rw http.ResponseWriter, r *http.Request) {
+	if err := h.tusStore.remove(mux.Vars(r)["id"]); err != nil {
+		slog.Error("tus terminate", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Tus-Resumable", tusResumableVersion)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// tusWriteChunk verifies an optional Upload-Checksum, persists the request body at offset and
+// updates the upload's metadata, finalizing it once complete. On failure it writes the error
+// response itself and returns ok=false; the caller is responsible for the success response.
+func (h *Handlers) tusWriteChunk(
+	rw http.ResponseWriter, r *http.Request, meta tusUploadMeta, offset int64,
+) (_ tusUploadMeta, ok bool) {
+	chunk, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return tusUploadMeta{}, false
+	}
+
+	if algo := r.Header.Get("Upload-Checksum"); algo != "" {
+		if err := verifyTusChecksum(algo, chunk); err != nil {
+			http.Error(rw, err.Error(), tusStatusChecksumMismatch)
+			return tusUploadMeta{}, false
+		}
+	}
+
+	n, err := h.tusStore.writeAt(meta.ID, offset, bytes.NewReader(chunk))
+	if err != nil {
+		slog.Error("tus write chunk", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return tusUploadMeta{}, false
+	}
+
+	meta.Offset = offset + n
+	if err := h.tusStore.saveInfo(meta); err != nil {
+		slog.Error("tus save info", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return tusUploadMeta{}, false
+	}
+
+	if meta.Offset == meta.Length {
+		if err := h.tusFinalize(r.Context(), rw, meta); err != nil {
+			slog.Error("tus finalize", err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return tusUploadMeta{}, false
+		}
+	}
+
+	return meta, true
+}
+
+// tusFinalize builds the CAR from the completed upload, runs it through the normal w3s store/add
+// and upload/add flow, and sets the resulting CIDs as response headers.
+func (h *Handlers) tusFinalize(ctx context.Context, rw http.ResponseWriter, meta tusUploadMeta) error {
+	f, err := h.tusStore.reader(meta.ID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	result, err := h.uploader.Upload(ctx, f, nil)
+	if err != nil {
+		return fmt.Errorf("uploading completed file: %s", err)
+	}
+
+	if err := h.tusStore.remove(meta.ID); err != nil {
+		return fmt.Errorf("cleaning up completed upload: %s", err)
+	}
+
+	rw.Header().Set("Upload-Root-Cid", result.Root.String())
+	rw.Header().Set("Upload-Shard-Cid", strings.Join(cidsToStrings(result.Shards), ","))
+	return nil
+}
+
+// parseTusMetadata decodes an Upload-Metadata header ("key base64value,key2 base64value2", per
+// the tus creation extension) into a plain map.
+func parseTusMetadata(header string) (map[string]string, error) {
+	if header == "" {
+		return nil, nil
+	}
+
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, " ", 2)
+		if parts[0] == "" {
+			return nil, fmt.Errorf("malformed Upload-Metadata header")
+		}
+
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("decoding Upload-Metadata value for %q: %s", parts[0], err)
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+// verifyTusChecksum validates chunk against the algorithm/base64-digest pair carried in an
+// Upload-Checksum header, per the tus checksum extension.
+func verifyTusChecksum(header string, chunk []byte) error {
+	algo, want, ok := strings.Cut(header, " ")
+	if !ok {
+		return fmt.Errorf("malformed Upload-Checksum header")
+	}
+
+	var sum []byte
+	switch algo {
+	case "sha1":
+		s := sha1.Sum(chunk) // nolint:gosec
+		sum = s[:]
+	case "sha256":
+		s := sha256.Sum256(chunk)
+		sum = s[:]
+	case "md5":
+		s := md5.Sum(chunk) // nolint:gosec
+		sum = s[:]
+	default:
+		return fmt.Errorf("unsupported checksum algorithm: %s", algo)
+	}
+
+	if got := base64.StdEncoding.EncodeToString(sum); got != want {
+		return fmt.Errorf("checksum mismatch")
+	}
+	return nil
+}
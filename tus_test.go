@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTusMetadata(t *testing.T) {
+	meta, err := parseTusMetadata("filename " + base64.StdEncoding.EncodeToString([]byte("test.txt")) + ",empty")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"filename": "test.txt", "empty": ""}, meta)
+
+	meta, err = parseTusMetadata("")
+	require.NoError(t, err)
+	require.Nil(t, meta)
+
+	// Leading OWS around a pair is trimmed away, so " badvalue" is just the valid key
+	// "badvalue" with an empty value, per the tus creation extension.
+	meta, err = parseTusMetadata(" badvalue")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"badvalue": ""}, meta)
+
+	_, err = parseTusMetadata("key not-base64!!!")
+	require.Error(t, err)
+}
+
+func TestVerifyTusChecksum(t *testing.T) {
+	chunk := []byte("hello world")
+	sum := sha256.Sum256(chunk)
+	header := "sha256 " + base64.StdEncoding.EncodeToString(sum[:])
+
+	require.NoError(t, verifyTusChecksum(header, chunk))
+	require.Error(t, verifyTusChecksum("sha256 "+base64.StdEncoding.EncodeToString([]byte("wrong")), chunk))
+	require.Error(t, verifyTusChecksum("unknown deadbeef", chunk))
+	require.Error(t, verifyTusChecksum("malformed-header", chunk))
+}
+
+func newTusTestHandlers(t *testing.T) *Handlers {
+	return &Handlers{
+		uploader: &Uploader{w3s: &mockClient{t: t}},
+		tusStore: newFsTusStore(t.TempDir()),
+	}
+}
+
+func TestTusUploadLifecycle(t *testing.T) {
+	h := newTusTestHandlers(t)
+
+	router := newRouter()
+	router.post("/api/v1/uploads", h.TusCreate)
+	router.head("/api/v1/uploads/{id}", h.TusHead)
+	router.patch("/api/v1/uploads/{id}", h.TusPatch)
+
+	server := httptest.NewServer(router.r)
+	defer server.Close()
+
+	content := []byte("Hello")
+
+	// Create the upload.
+	createReq, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/uploads", nil)
+	require.NoError(t, err)
+	createReq.Header.Set("Upload-Length", strconv.Itoa(len(content)))
+	createRes, err := http.DefaultClient.Do(createReq)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, createRes.StatusCode)
+	require.NoError(t, createRes.Body.Close())
+
+	location := createRes.Header.Get("Location")
+	require.NotEmpty(t, location)
+
+	// HEAD reports the fresh upload's offset.
+	headRes, err := http.DefaultClient.Do(mustRequest(t, http.MethodHead, server.URL+location, nil))
+	require.NoError(t, err)
+	require.Equal(t, "0", headRes.Header.Get("Upload-Offset"))
+	require.NoError(t, headRes.Body.Close())
+
+	// A PATCH at the wrong offset is rejected with a conflict.
+	badPatch := mustRequest(t, http.MethodPatch, server.URL+location, bytes.NewReader(content))
+	badPatch.Header.Set("Content-Type", "application/offset+octet-stream")
+	badPatch.Header.Set("Upload-Offset", "1")
+	badPatchRes, err := http.DefaultClient.Do(badPatch)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusConflict, badPatchRes.StatusCode)
+	require.NoError(t, badPatchRes.Body.Close())
+
+	// The correct PATCH completes the upload and finalizes it.
+	patch := mustRequest(t, http.MethodPatch, server.URL+location, bytes.NewReader(content))
+	patch.Header.Set("Content-Type", "application/offset+octet-stream")
+	patch.Header.Set("Upload-Offset", "0")
+	patchRes, err := http.DefaultClient.Do(patch)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNoContent, patchRes.StatusCode)
+	require.Equal(t, strconv.Itoa(len(content)), patchRes.Header.Get("Upload-Offset"))
+	require.NotEmpty(t, patchRes.Header.Get("Upload-Root-Cid"))
+	require.NoError(t, patchRes.Body.Close())
+}
+
+func mustRequest(t *testing.T, method, url string, body *bytes.Reader) *http.Request {
+	t.Helper()
+	if body == nil {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	return req
+}
@@ -3,24 +3,20 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-libipfs/blocks"
 	"github.com/ipfs/go-unixfsnode/data/builder"
-	"github.com/ipld/go-car/v2"
-	"github.com/ipld/go-car/v2/blockstore"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
-	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
-	ucanto_car "github.com/web3-storage/go-ucanto/core/car"
 	"github.com/web3-storage/go-ucanto/core/delegation"
 	"github.com/web3-storage/go-ucanto/did"
 	"github.com/web3-storage/go-ucanto/principal"
@@ -31,122 +27,135 @@ import (
 	"github.com/web3-storage/go-w3up/client"
 	"github.com/web3-storage/go-w3up/cmd/util"
 	w3sdelegation "github.com/web3-storage/go-w3up/delegation"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/errgroup"
 )
 
+// blockChanBuffer bounds how many built-but-not-yet-shipped UnixFS blocks can sit ahead of the
+// shard assembler, so a slow uploader applies backpressure instead of the whole file piling up
+// in memory.
+const blockChanBuffer = 64
+
 // w3s interface to make it easier to mock w3s.
 type w3s interface {
-	upload(cid.Cid, string) (cid.Cid, []ipld.Link, error)
+	upload(context.Context, io.Reader) (cid.Cid, []ipld.Link, error)
+	presign(link ipld.Link, size uint64) (shardPresign, error)
+	finalize(root cid.Cid, shards []ipld.Link) (cid.Cid, []ipld.Link, error)
+}
+
+// shardPresign is the result of presigning a single shard: either it's already stored ("done")
+// or the caller must PUT it to URL with Headers ("upload").
+type shardPresign struct {
+	Status  string
+	URL     string
+	Headers map[string]string
 }
 
 // Uploader ...
 type Uploader struct {
-	w3s    w3s
-	tmpDir string
+	w3s w3s
 }
 
 // UploadResult ..
 type UploadResult struct {
-	Root  cid.Cid
-	Shard cid.Cid
+	Root   cid.Cid
+	Shards []cid.Cid
+	Hashes map[string]string
+}
+
+// UploadConfig tunes how shards are shipped to w3s once they're built.
+type UploadConfig struct {
+	// Concurrency bounds how many shards are in flight to w3s at once. Zero or negative means 1.
+	Concurrency int
+	// MaxAttempts bounds how many times a single shard PUT is tried, the first try included,
+	// before the upload fails. Zero or negative means 1 (no retries).
+	MaxAttempts int
 }
 
 // NewUploader returns a new uploader.
-func NewUploader(spaceID string, sk string, proofBytes []byte, tmpDir string) (*Uploader, error) {
-	client, err := newW3sclient(spaceID, sk, proofBytes)
+func NewUploader(spaceID string, sk string, proofBytes []byte, uploadCfg UploadConfig) (*Uploader, error) {
+	client, err := newW3sclient(spaceID, sk, proofBytes, uploadCfg)
 	if err != nil {
 		return nil, fmt.Errorf("creating new w3s client: %s", err)
 	}
 	return &Uploader{
-		w3s:    client,
-		tmpDir: tmpDir,
+		w3s: client,
 	}, nil
 }
 
-// Upload uploads the content of a io.Reader.
-func (u *Uploader) Upload(ctx context.Context, r io.Reader) (_ UploadResult, err error) {
-	randBytes := make([]byte, 16)
-	_, _ = rand.Read(randBytes)
-	dest := filepath.Join(u.tmpDir, hex.EncodeToString(randBytes))
-	dest = fmt.Sprintf("%s.car", dest)
+// Upload uploads the content of a io.Reader, building and shipping CAR shards as the content is
+// read instead of materializing a full CAR first. If algos is non-empty, it also computes a
+// whole-payload digest for each requested algorithm as the bytes flow through, with no second
+// read of the content.
+func (u *Uploader) Upload(ctx context.Context, r io.Reader, algos []string) (UploadResult, error) {
+	hashes, err := newHashSet(algos)
+	if err != nil {
+		return UploadResult{}, err
+	}
 
-	defer func() {
-		if cErr := u.removeTmp(dest); err == nil {
-			err = cErr
+	tee := r
+	if len(hashes) > 0 {
+		writers := make([]io.Writer, len(hashes))
+		for i, h := range hashes {
+			writers[i] = h.hash
 		}
-	}()
-
-	root, err := u.createCar(ctx, dest, r)
-	if err != nil {
-		return UploadResult{}, fmt.Errorf("failed generating CAR: %s", err)
+		tee = io.TeeReader(r, io.MultiWriter(writers...))
 	}
 
-	root, shards, err := u.w3s.upload(root, dest)
+	root, shards, err := u.w3s.upload(ctx, tee)
 	if err != nil {
 		return UploadResult{}, fmt.Errorf("failed archiving CAR: %s", err)
 	}
 
 	return UploadResult{
-		Root:  root,
-		Shard: cid.MustParse(shards[0].String()),
+		Root:   root,
+		Shards: linksToCids(shards),
+		Hashes: hashes.sums(),
 	}, nil
 }
 
-func (u *Uploader) createCar(ctx context.Context, dest string, r io.Reader) (cid.Cid, error) {
-	hasher, err := multihash.GetHasher(multihash.SHA2_256)
-	if err != nil {
-		return cid.Cid{}, err
-	}
-	digest := hasher.Sum([]byte{})
-	hash, err := multihash.Encode(digest, multihash.SHA2_256)
-	if err != nil {
-		return cid.Cid{}, err
-	}
-	proxyRoot := cid.NewCidV1(uint64(multicodec.DagPb), hash)
+// Presign requests a presigned upload location for a shard the caller has already built
+// locally, without the service needing to hold the shard's bytes.
+func (u *Uploader) Presign(link ipld.Link, size uint64) (shardPresign, error) {
+	return u.w3s.presign(link, size)
+}
 
-	cdest, err := blockstore.OpenReadWrite(
-		dest, []cid.Cid{proxyRoot}, []car.Option{blockstore.WriteAsCarV1(true)}...,
-	)
-	if err != nil {
-		return cid.Cid{}, err
+// Finalize completes an accelerated upload once the caller has PUT every shard itself.
+func (u *Uploader) Finalize(root cid.Cid, shards []ipld.Link) (UploadResult, error) {
+	if len(shards) == 0 {
+		return UploadResult{}, fmt.Errorf("shards must not be empty")
 	}
 
-	// Write the unixfs blocks into the store.
-	root, _, err := writeFile(ctx, cdest, r)
+	root, shards, err := u.w3s.finalize(root, shards)
 	if err != nil {
-		return cid.Cid{}, err
-	}
-
-	if err := cdest.Finalize(); err != nil {
-		return cid.Cid{}, err
-	}
-	// re-open/finalize with the final root.
-	if err := car.ReplaceRootsInFile(dest, []cid.Cid{root}); err != nil {
-		return cid.Cid{}, err
+		return UploadResult{}, fmt.Errorf("failed finalizing upload: %s", err)
 	}
 
-	return root, nil
+	return UploadResult{
+		Root:   root,
+		Shards: linksToCids(shards),
+	}, nil
 }
 
-func (*Uploader) removeTmp(dest string) error {
-	if err := os.Remove(dest); err != nil {
-		return fmt.Errorf("failed to remove file: %s", err)
+// linksToCids converts every link in shards to a cid.Cid, assuming each is a cidlink.Link as
+// produced by this package's own w3s implementations.
+func linksToCids(shards []ipld.Link) []cid.Cid {
+	cids := make([]cid.Cid, len(shards))
+	for i, s := range shards {
+		cids[i] = cid.MustParse(s.String())
 	}
-	return nil
+	return cids
 }
 
-func writeFile(ctx context.Context, bs *blockstore.ReadWrite, reader io.Reader) (_ cid.Cid, sz uint64, err error) {
+// writeFile streams reader through the UnixFS builder, emitting each produced block on blocksCh
+// as soon as it's written so that shards can be assembled and uploaded before the whole file has
+// been read. writeFile keeps no block after emitting it; what is held downstream is bounded by
+// blockChanBuffer and by the shards being assembled and uploaded.
+func writeFile(ctx context.Context, blocksCh chan<- blocks.Block, reader io.Reader) (cid.Cid, error) {
 	ls := cidlink.DefaultLinkSystem()
 	ls.TrustedStorage = true
 	ls.StorageReadOpener = func(_ ipld.LinkContext, l ipld.Link) (io.Reader, error) {
-		cl, ok := l.(cidlink.Link)
-		if !ok {
-			return nil, fmt.Errorf("not a cidlink")
-		}
-		blk, err := bs.Get(ctx, cl.Cid)
-		if err != nil {
-			return nil, err
-		}
-		return bytes.NewBuffer(blk.RawData()), nil
+		return nil, fmt.Errorf("reading back %s: blocks are not retained in streaming mode", l)
 	}
 	ls.StorageWriteOpener = func(_ ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
 		buf := bytes.NewBuffer(nil)
@@ -159,32 +168,36 @@ func writeFile(ctx context.Context, bs *blockstore.ReadWrite, reader io.Reader)
 			if err != nil {
 				return fmt.Errorf("new block with cid: %s", err)
 			}
-			if err := bs.Put(ctx, blk); err != nil {
-				return fmt.Errorf("put: %s", err)
+			select {
+			case blocksCh <- blk:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 			return nil
 		}, nil
 	}
 
-	l, size, err := builder.BuildUnixFSFile(reader, "", &ls)
+	l, _, err := builder.BuildUnixFSFile(reader, "", &ls)
 	if err != nil {
-		return cid.Undef, 0, err
+		return cid.Undef, err
 	}
 
 	rcl, ok := l.(cidlink.Link)
 	if !ok {
-		return cid.Undef, 0, fmt.Errorf("could not interpret %s", l)
+		return cid.Undef, fmt.Errorf("could not interpret %s", l)
 	}
-	return rcl.Cid, size, nil
+	return rcl.Cid, nil
 }
 
 type w3sclient struct {
-	space  did.DID
-	issuer principal.Signer
-	proof  delegation.Delegation
+	space       did.DID
+	issuer      principal.Signer
+	proof       delegation.Delegation
+	concurrency int
+	retry       retryConfig
 }
 
-func newW3sclient(spaceID string, sk string, proofBytes []byte) (*w3sclient, error) {
+func newW3sclient(spaceID string, sk string, proofBytes []byte, uploadCfg UploadConfig) (*w3sclient, error) {
 	// private key to sign UCAN invocations with
 	issuer, err := signer.Parse(sk)
 	if err != nil {
@@ -202,147 +215,311 @@ func newW3sclient(spaceID string, sk string, proofBytes []byte) (*w3sclient, err
 		return nil, fmt.Errorf("failed to parse space id: %s", err)
 	}
 
+	concurrency := uploadCfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
 	return &w3sclient{
-		issuer: issuer,
-		proof:  proof,
-		space:  space,
+		issuer:      issuer,
+		proof:       proof,
+		space:       space,
+		concurrency: concurrency,
+		retry: retryConfig{
+			maxAttempts: uploadCfg.MaxAttempts,
+			baseDelay:   200 * time.Millisecond,
+			maxDelay:    10 * time.Second,
+		},
 	}, nil
 }
 
-func (c *w3sclient) upload(root cid.Cid, dest string) (_ cid.Cid, _ []ipld.Link, err error) {
-	// no need to close the file because the http client is doing that
-	f, err := os.Open(dest)
-	if err != nil {
-		return cid.Undef, []ipld.Link{}, err
-	}
-	defer func() {
-		// Close file and override return error type if it is nil.
-		if cerr := f.Close(); err == nil {
-			err = cerr
-		}
+// upload streams r through the UnixFS builder and, shard by shard as sharding.ShardSize fills up,
+// ships it to w3s through a bounded worker pool so that a slow shard PUT doesn't serialize behind
+// the next one. Shard links are collected by the index they were read in, so the order handed to
+// uploadadd is deterministic regardless of which worker finishes first. The whole batch is
+// canceled on the first fatal error.
+func (c *w3sclient) upload(ctx context.Context, r io.Reader) (cid.Cid, []ipld.Link, error) {
+	blocksCh := make(chan blocks.Block, blockChanBuffer)
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(c.concurrency)
+
+	var root cid.Cid
+	var writeErr error
+	go func() {
+		defer close(blocksCh)
+		// Build against gctx, not ctx, so a shard failure (which cancels gctx) also stops the
+		// producer instead of letting it build out the rest of a multi-GB file for nothing.
+		root, writeErr = writeFile(gctx, blocksCh, r)
 	}()
 
-	stat, err := f.Stat()
+	shds, err := sharding.NewSharder([]ipld.Link{}, blocksCh)
 	if err != nil {
-		return cid.Undef, []ipld.Link{}, err
+		return cid.Undef, []ipld.Link{}, fmt.Errorf("sharding CAR: %s", err)
 	}
 
-	var shdlnks []ipld.Link
-
-	size := uint64(stat.Size())
-	if size < sharding.ShardSize {
-		link, err := storeShard(c.issuer, c.space, f, []delegation.Delegation{c.proof})
+	var (
+		mu      sync.Mutex
+		shdlnks = map[int]ipld.Link{}
+		count   int
+	)
+	proofs := []delegation.Delegation{c.proof}
+	for {
+		shd, err := shds.Next()
 		if err != nil {
+			if err == io.EOF {
+				break
+			}
 			return cid.Undef, []ipld.Link{}, err
 		}
-		shdlnks = append(shdlnks, link)
-	} else {
-		_, blocks, err := ucanto_car.Decode(f)
-		if err != nil {
-			return cid.Undef, []ipld.Link{}, fmt.Errorf("decoding CAR: %s", err)
-		}
-		shds, err := sharding.NewSharder([]ipld.Link{}, blocks)
-		if err != nil {
-			return cid.Undef, []ipld.Link{}, fmt.Errorf("sharding CAR: %s", err)
+
+		// Next must not be called again until shd has been fully read, so drain it here on the
+		// main goroutine and hand the bytes off to the worker pool for the (parallelizable)
+		// presign/PUT.
+		buf := new(bytes.Buffer)
+		if _, err := buf.ReadFrom(shd); err != nil {
+			return cid.Undef, []ipld.Link{}, fmt.Errorf("reading CAR: %s", err)
 		}
 
-		for {
-			shd, err := shds.Next()
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-				return cid.Undef, []ipld.Link{}, err
-			}
-			link, err := storeShard(c.issuer, c.space, shd, []delegation.Delegation{c.proof})
+		i := count
+		count++
+		data := buf.Bytes()
+		g.Go(func() error {
+			link, err := storeShard(gctx, c.issuer, c.space, data, proofs, c.retry)
 			if err != nil {
-				return cid.Undef, []ipld.Link{}, err
+				return err
 			}
-			shdlnks = append(shdlnks, link)
-		}
+			mu.Lock()
+			shdlnks[i] = link
+			mu.Unlock()
+			return nil
+		})
 	}
 
-	rcpt2, err := client.UploadAdd(
-		c.issuer,
-		c.space,
-		&uploadadd.Caveat{Root: cidlink.Link{Cid: root}, Shards: shdlnks},
-		client.WithConnection(util.MustGetConnection()),
-		client.WithProofs([]delegation.Delegation{c.proof}),
-	)
-	if err != nil {
+	if err := g.Wait(); err != nil {
 		return cid.Undef, []ipld.Link{}, err
 	}
 
-	if rcpt2.Out().Error() != nil {
-		return cid.Undef, []ipld.Link{}, fmt.Errorf("%s", rcpt2.Out().Error().Message)
+	if writeErr != nil {
+		return cid.Undef, []ipld.Link{}, fmt.Errorf("building UnixFS DAG: %s", writeErr)
 	}
 
-	return root, shdlnks, nil
+	ordered := make([]ipld.Link, count)
+	for i := 0; i < count; i++ {
+		ordered[i] = shdlnks[i]
+	}
+
+	return c.finalize(root, ordered)
 }
 
-func storeShard(
-	issuer principal.Signer, space did.DID, shard io.Reader, proofs []delegation.Delegation,
-) (ipld.Link, error) {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(shard)
+// presign requests a presigned upload location for a shard identified only by its CID and size,
+// without requiring its bytes.
+func (c *w3sclient) presign(link ipld.Link, size uint64) (shardPresign, error) {
+	return presignShard(c.issuer, c.space, link, size, []delegation.Delegation{c.proof})
+}
+
+// finalize issues the upload/add invocation tying root to shards, once every shard has landed in
+// the space (whether shipped locally via storeShard or PUT directly by an accelerator client).
+func (c *w3sclient) finalize(root cid.Cid, shards []ipld.Link) (cid.Cid, []ipld.Link, error) {
+	rcpt, err := client.UploadAdd(
+		c.issuer,
+		c.space,
+		&uploadadd.Caveat{Root: cidlink.Link{Cid: root}, Shards: shards},
+		client.WithConnection(util.MustGetConnection()),
+		client.WithProofs([]delegation.Delegation{c.proof}),
+	)
 	if err != nil {
-		return nil, fmt.Errorf("reading CAR: %s", err)
+		return cid.Undef, nil, err
 	}
 
-	mh, err := multihash.Sum(buf.Bytes(), multihash.SHA2_256, -1)
-	if err != nil {
-		return nil, fmt.Errorf("hashing CAR: %s", err)
+	if rcpt.Out().Error() != nil {
+		return cid.Undef, nil, fmt.Errorf("%s", rcpt.Out().Error().Message)
 	}
 
-	link := cidlink.Link{Cid: cid.NewCidV1(0x0202, mh)}
+	return root, shards, nil
+}
 
+// presignShard asks w3s for where (and whether) a shard identified by link/size needs to be
+// uploaded, without needing the shard's bytes.
+func presignShard(
+	issuer principal.Signer, space did.DID, link ipld.Link, size uint64, proofs []delegation.Delegation,
+) (shardPresign, error) {
 	rcpt, err := client.StoreAdd(
 		issuer,
 		space,
 		&storeadd.Caveat{
 			Link: link,
-			Size: uint64(buf.Len()),
+			Size: size,
 		},
 		client.WithConnection(util.MustGetConnection()),
 		client.WithProofs(proofs),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("store/add %s: %s", link, err)
+		return shardPresign{}, fmt.Errorf("store/add %s: %s", link, err)
 	}
 
 	if rcpt.Out().Error() != nil {
-		return nil, fmt.Errorf("%+v", rcpt.Out().Error())
+		return shardPresign{}, fmt.Errorf("%+v", rcpt.Out().Error())
 	}
 
-	if rcpt.Out().Ok().Status == "upload" {
-		hr, err := http.NewRequest("PUT", *rcpt.Out().Ok().Url, bytes.NewReader(buf.Bytes()))
-		if err != nil {
-			return nil, fmt.Errorf("creating HTTP request: %s", err)
-		}
-
-		hdr := map[string][]string{}
+	presign := shardPresign{Status: rcpt.Out().Ok().Status}
+	if presign.Status == "upload" {
+		presign.URL = *rcpt.Out().Ok().Url
+		presign.Headers = map[string]string{}
 		for k, v := range rcpt.Out().Ok().Headers.Values {
 			if k == "content-length" {
 				continue
 			}
-			hdr[k] = []string{v}
+			presign.Headers[k] = v
 		}
+	}
+
+	return presign, nil
+}
+
+// retryConfig controls how a shard PUT is retried on failure.
+type retryConfig struct {
+	// maxAttempts is the total number of tries, including the first. <= 0 means 1 (no retries).
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+func (r retryConfig) attempts() int {
+	if r.maxAttempts <= 0 {
+		return 1
+	}
+	return r.maxAttempts
+}
 
-		hr.Header = hdr
-		hr.ContentLength = int64(buf.Len())
-		httpClient := http.Client{}
-		res, err := httpClient.Do(hr)
+// backoff returns how long to wait before the given attempt (1-indexed), using exponential
+// backoff with full jitter so retrying workers don't all hammer w3s at once.
+func (r retryConfig) backoff(attempt int) time.Duration {
+	d := r.baseDelay << uint(attempt-1)
+	if d <= 0 || d > r.maxDelay {
+		d = r.maxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// putShard uploads data to an "upload"-status shardPresign's URL, retrying on network errors and
+// 5xx/429 responses with exponential backoff, honoring a 429's Retry-After if present.
+func putShard(ctx context.Context, presign shardPresign, data []byte, retry retryConfig) error {
+	var lastErr error
+	var wait time.Duration
+	for attempt := 1; attempt <= retry.attempts(); attempt++ {
+		if attempt > 1 {
+			uploadShardRetries.Inc()
+			if err := sleepCtx(ctx, wait); err != nil {
+				return err
+			}
+		}
+		wait = retry.backoff(attempt + 1)
+
+		res, err := doPutShard(ctx, presign, data)
 		if err != nil {
-			return nil, fmt.Errorf("doing HTTP request: %s", err)
+			lastErr = err
+			continue
 		}
-		if res.StatusCode != 200 {
-			return nil, fmt.Errorf("non-200 status code while uploading file: %d", res.StatusCode)
+
+		switch {
+		case res.StatusCode == http.StatusOK:
+			_ = res.Body.Close()
+			return nil
+		case res.StatusCode == http.StatusTooManyRequests:
+			wait = retryAfterDelay(res.Header.Get("Retry-After"), wait)
+			_ = res.Body.Close()
+			lastErr = fmt.Errorf("rate limited (429)")
+		case res.StatusCode >= 500:
+			_ = res.Body.Close()
+			lastErr = fmt.Errorf("server error: %d", res.StatusCode)
+		default:
+			_ = res.Body.Close()
+			return fmt.Errorf("non-200 status code while uploading file: %d", res.StatusCode)
 		}
-		err = res.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("closing request body: %s", err)
+	}
+
+	uploadShardFailures.Inc()
+	return fmt.Errorf("giving up uploading shard after %d attempts: %s", retry.attempts(), lastErr)
+}
+
+func doPutShard(ctx context.Context, presign shardPresign, data []byte) (*http.Response, error) {
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPut, presign.URL, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("creating HTTP request: %s", err)
+	}
+
+	hdr := map[string][]string{}
+	for k, v := range presign.Headers {
+		hdr[k] = []string{v}
+	}
+	hr.Header = hdr
+	hr.ContentLength = int64(len(data))
+
+	res, err := http.DefaultClient.Do(hr)
+	if err != nil {
+		return nil, fmt.Errorf("doing HTTP request: %s", err)
+	}
+	return res, nil
+}
+
+// retryAfterDelay parses a Retry-After header (delay-seconds or HTTP-date form), falling back to
+// fallback if the header is absent or unparseable.
+func retryAfterDelay(header string, fallback time.Duration) time.Duration {
+	if header == "" {
+		return fallback
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// storeShard presigns and, if required, PUTs a single already-built CAR shard, recording its size
+// and latency for observability.
+func storeShard(
+	ctx context.Context, issuer principal.Signer, space did.DID, data []byte, proofs []delegation.Delegation,
+	retry retryConfig,
+) (ipld.Link, error) {
+	start := time.Now()
+
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		return nil, fmt.Errorf("hashing CAR: %s", err)
+	}
+
+	link := cidlink.Link{Cid: cid.NewCidV1(0x0202, mh)}
+
+	presign, err := presignShard(issuer, space, link, uint64(len(data)), proofs)
+	if err != nil {
+		return nil, err
+	}
+
+	if presign.Status == "upload" {
+		if err := putShard(ctx, presign, data, retry); err != nil {
+			return nil, err
 		}
 	}
 
+	uploadShardBytes.Observe(float64(len(data)))
+	uploadShardLatency.Observe(time.Since(start).Seconds())
+	slog.Info("shard uploaded", "cid", link.Cid.String(), "bytes", len(data), "took", time.Since(start))
+
 	return link, nil
 }
@@ -2,85 +2,84 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"io"
+	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	_ "github.com/ipfs/go-unixfsnode/file"
-	"github.com/ipld/go-car/v2/blockstore"
-	"github.com/ipld/go-car/v2/storage"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/stretchr/testify/require"
 )
 
-// TestUploader uses a mock to test a lot of internal things that should be happening under the hood.
+// TestUploader checks that Upload hands the reader's content through to the w3s client
+// unchanged.
 func TestUploader(t *testing.T) {
 	client := &mockClient{t: t}
 	uploader := &Uploader{
-		w3s:    client,
-		tmpDir: t.TempDir(),
+		w3s: client,
 	}
 
-	_, err := uploader.Upload(context.Background(), strings.NewReader("Hello"))
+	_, err := uploader.Upload(context.Background(), strings.NewReader("Hello"), nil)
 	require.NoError(t, err)
-
-	// check that the tmp files were removed
-	_, err = os.Stat(client.dest)
-	require.True(t, os.IsNotExist(err))
-
-	_, err = os.Stat(fmt.Sprintf("%s.car", client.dest))
-	require.True(t, os.IsNotExist(err))
+	require.Equal(t, "Hello", client.content)
 }
 
 type mockClient struct {
-	t    *testing.T
-	dest string
+	t       *testing.T
+	content string
 }
 
-func (c *mockClient) upload(_ cid.Cid, dest string) (cid.Cid, error) {
-	c.dest = dest
-
-	// check tmp file exists
-	_, err := os.Stat(dest)
+func (c *mockClient) upload(_ context.Context, r io.Reader) (cid.Cid, []ipld.Link, error) {
+	content, err := io.ReadAll(r)
 	require.NoError(c.t, err)
+	c.content = string(content)
 
-	// check tmp car file exists
-	_, err = os.Stat(fmt.Sprintf("%s.car", dest))
-	require.NoError(c.t, err)
+	root := cid.MustParse("bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku")
+	return root, []ipld.Link{cidlink.Link{Cid: root}}, nil
+}
 
-	// check content being uploaded
-	content, err := extract(fmt.Sprintf("%s.car", dest))
-	require.NoError(c.t, err)
-	require.Equal(c.t, "Hello", content)
+func (c *mockClient) presign(_ ipld.Link, _ uint64) (shardPresign, error) {
+	return shardPresign{Status: "done"}, nil
+}
 
-	return cid.Cid{}, nil
+func (c *mockClient) finalize(root cid.Cid, shards []ipld.Link) (cid.Cid, []ipld.Link, error) {
+	return root, shards, nil
 }
 
-func extract(filename string) (string, error) {
-	bs, err := blockstore.OpenReadOnly(filename)
-	if err != nil {
-		return "", err
-	}
+func TestRetryConfigAttempts(t *testing.T) {
+	require.Equal(t, 1, retryConfig{}.attempts())
+	require.Equal(t, 1, retryConfig{maxAttempts: -1}.attempts())
+	require.Equal(t, 3, retryConfig{maxAttempts: 3}.attempts())
+}
 
-	carFile, err := os.Open(filename)
-	if err != nil {
-		return "", err
-	}
-	store, err := storage.OpenReadable(carFile)
-	if err != nil {
-		return "", err
-	}
+func TestRetryConfigBackoff(t *testing.T) {
+	r := retryConfig{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
 
-	blkCid, err := cid.Parse(store.Roots()[0].String())
-	if err != nil {
-		return "", err
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := r.backoff(attempt)
+		require.GreaterOrEqual(t, d, time.Duration(0))
+		require.LessOrEqual(t, d, r.maxDelay)
 	}
+}
 
-	blk, err := bs.Get(context.Background(), blkCid)
-	if err != nil {
-		return "", err
-	}
+func TestRetryAfterDelay(t *testing.T) {
+	fallback := 42 * time.Second
+
+	require.Equal(t, fallback, retryAfterDelay("", fallback))
+	require.Equal(t, 5*time.Second, retryAfterDelay("5", fallback))
+
+	future := time.Now().Add(10 * time.Second)
+	d := retryAfterDelay(future.Format(http.TimeFormat), fallback)
+	require.Greater(t, d, time.Duration(0))
+	require.LessOrEqual(t, d, 10*time.Second)
+
+	// A date in the past falls back, since there's nothing left to wait for.
+	past := time.Now().Add(-10 * time.Second)
+	require.Equal(t, fallback, retryAfterDelay(past.Format(http.TimeFormat), fallback))
 
-	return string(blk.RawData()), nil
+	require.Equal(t, fallback, retryAfterDelay("not-a-valid-header", fallback))
 }